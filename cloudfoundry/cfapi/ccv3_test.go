@@ -0,0 +1,97 @@
+package cfapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"code.cloudfoundry.org/cli/cf/configuration"
+	"code.cloudfoundry.org/cli/cf/configuration/coreconfig"
+)
+
+func TestListOptionsQuery(t *testing.T) {
+	opts := ListOptions{
+		LabelSelector: "team=payments",
+		Names:         []string{"a", "b"},
+		PerPage:       50,
+		OrderBy:       "-created_at",
+	}
+
+	q := opts.query()
+	if got := q.Get("label_selector"); got != "team=payments" {
+		t.Errorf("label_selector = %q, want %q", got, "team=payments")
+	}
+	if got := q.Get("names"); got != "a,b" {
+		t.Errorf("names = %q, want %q", got, "a,b")
+	}
+	if got := q.Get("per_page"); got != "50" {
+		t.Errorf("per_page = %q, want %q", got, "50")
+	}
+	if got := q.Get("order_by"); got != "-created_at" {
+		t.Errorf("order_by = %q, want %q", got, "-created_at")
+	}
+}
+
+func TestListOptionsQueryOmitsUnset(t *testing.T) {
+	q := ListOptions{}.query()
+	if len(q) != 0 {
+		t.Errorf("expected no query parameters for zero-value ListOptions, got %v", q)
+	}
+}
+
+// TestCCv3GetFollowsPaginationUntilExhausted exercises the loop in CCv3Get
+// against a fake 3-page CCv3 collection, asserting it stops once
+// pagination.next.href comes back empty and that every page's resources
+// reach the caller.
+func TestCCv3GetFollowsPaginationUntilExhausted(t *testing.T) {
+	var server *httptest.Server
+	requestCount := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/organizations", func(w http.ResponseWriter, r *http.Request) {
+		requestCount++
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Query().Get("page") {
+		case "":
+			fmt.Fprintf(w, `{"pagination":{"next":{"href":%q}},"resources":[{"guid":"1","name":"org-1"}]}`,
+				server.URL+"/v3/organizations?page=2")
+		case "2":
+			fmt.Fprintf(w, `{"pagination":{"next":{"href":%q}},"resources":[{"guid":"2","name":"org-2"}]}`,
+				server.URL+"/v3/organizations?page=3")
+		case "3":
+			fmt.Fprint(w, `{"pagination":{"next":{"href":""}},"resources":[{"guid":"3","name":"org-3"}]}`)
+		}
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	s := &Session{httpClient: server.Client()}
+	s.config = coreconfig.NewRepositoryFromPersistor(&noopTestPersistor{}, func(error) {})
+	s.config.SetAPIEndpoint(server.URL)
+
+	resources, err := s.ListResourcesWithOptions(CCv3Organizations, ListOptions{})
+	if err != nil {
+		t.Fatalf("ListResourcesWithOptions returned error: %s", err)
+	}
+
+	if requestCount != 3 {
+		t.Fatalf("expected 3 page requests, got %d", requestCount)
+	}
+	if len(resources) != 3 {
+		t.Fatalf("expected 3 resources across all pages, got %d", len(resources))
+	}
+	if resources[0].GUID != "1" || resources[2].GUID != "3" {
+		t.Fatalf("unexpected resources: %+v", resources)
+	}
+}
+
+// noopTestPersistor satisfies configuration.Persistor with nothing behind
+// it, for tests that need a coreconfig.Repository but nothing to persist.
+type noopTestPersistor struct{}
+
+func (p *noopTestPersistor) Delete()                                {}
+func (p *noopTestPersistor) Exists() bool                           { return false }
+func (p *noopTestPersistor) Load(configuration.DataInterface) error { return nil }
+func (p *noopTestPersistor) Save(configuration.DataInterface) error { return nil }
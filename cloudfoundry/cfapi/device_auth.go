@@ -0,0 +1,222 @@
+package cfapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// deviceAuthorizationResponse is UAA's response to POST /oauth/device_authorize.
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// deviceTokenResponse is UAA's response to a successful poll of /oauth/token
+// using the device_code grant.
+type deviceTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+}
+
+const (
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	deviceErrAuthorizationPending = "authorization_pending"
+	deviceErrSlowDown             = "slow_down"
+	deviceErrExpiredToken         = "expired_token"
+	deviceErrAccessDenied         = "access_denied"
+
+	defaultDevicePollInterval = 5 * time.Second
+)
+
+// deviceFlowSleep waits out the poll interval between device token polls.
+// It's a variable rather than a direct time.Sleep call so tests can drive
+// the authenticateDeviceFlow state machine without waiting out real poll
+// intervals and backoffs.
+var deviceFlowSleep = time.Sleep
+
+// authenticateDeviceFlow drives the OAuth 2.0 device authorization grant
+// (RFC 8628) against UAA: it requests a device/user code pair, prints the
+// verification URI for the operator to open, then polls the token endpoint
+// at the interval UAA asked for until the grant is approved, denied, or
+// expires.
+func (s *Session) authenticateDeviceFlow(uaaClientID string) error {
+
+	uaaEndpoint := s.config.UaaEndpoint()
+
+	authResp, err := s.requestDeviceAuthorization(uaaEndpoint, uaaClientID)
+	if err != nil {
+		return err
+	}
+
+	s.Log.UI.Say("To authenticate, open %s and confirm code %s",
+		authResp.VerificationURIComplete, authResp.UserCode)
+
+	interval := time.Duration(authResp.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDevicePollInterval
+	}
+	deadline := time.Now().Add(time.Duration(authResp.ExpiresIn) * time.Second)
+
+	for {
+		deviceFlowSleep(interval)
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("device authorization expired before it was approved")
+		}
+
+		token, pollErr := s.pollDeviceToken(uaaEndpoint, uaaClientID, authResp.DeviceCode)
+		if pollErr == nil {
+			s.config.SetAccessToken(strings.TrimSpace(token.TokenType + " " + token.AccessToken))
+			s.config.SetRefreshToken(token.RefreshToken)
+			return nil
+		}
+
+		switch pollErr.Error() {
+		case deviceErrAuthorizationPending:
+			continue
+		case deviceErrSlowDown:
+			interval += 5 * time.Second
+			continue
+		case deviceErrExpiredToken:
+			return fmt.Errorf("device code expired before authorization was completed")
+		case deviceErrAccessDenied:
+			return fmt.Errorf("device authorization was denied")
+		default:
+			return pollErr
+		}
+	}
+}
+
+// requestDeviceAuthorization POSTs to UAA's /oauth/device_authorize and
+// returns the device/user code pair the operator must confirm.
+func (s *Session) requestDeviceAuthorization(uaaEndpoint, uaaClientID string) (*deviceAuthorizationResponse, error) {
+
+	form := url.Values{
+		"client_id":     {uaaClientID},
+		"response_type": {"device_code"},
+	}
+
+	body, err := s.postDeviceForm(uaaEndpoint+"/oauth/device_authorize", form)
+	if err != nil {
+		return nil, err
+	}
+
+	authResp := &deviceAuthorizationResponse{}
+	if err := json.Unmarshal(body, authResp); err != nil {
+		return nil, err
+	}
+	return authResp, nil
+}
+
+// pollDeviceToken makes a single poll of UAA's /oauth/token using the
+// device_code grant. A non-nil error whose message is one of the RFC 8628
+// error codes (authorization_pending, slow_down, expired_token,
+// access_denied) signals the caller should keep polling, back off, or stop.
+func (s *Session) pollDeviceToken(uaaEndpoint, uaaClientID, deviceCode string) (*deviceTokenResponse, error) {
+
+	form := url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"client_id":   {uaaClientID},
+		"device_code": {deviceCode},
+	}
+
+	body, err := s.postDeviceForm(uaaEndpoint+"/oauth/token", form)
+	if err != nil {
+		uaaErr := uaaErrorResponse{}
+		if jsonErr := json.Unmarshal(body, &uaaErr); jsonErr == nil && uaaErr.Code != "" {
+			return nil, fmt.Errorf("%s", uaaErr.Code)
+		}
+		return nil, err
+	}
+
+	token := &deviceTokenResponse{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// oauthClientTokenRefresher implements net.Gateway's token-refresher
+// interface for a session that authenticated with an OAuth client other
+// than the CF CLI's own default (device flow, mTLS/jwt-bearer). UAA ties a
+// refresh token to the client it was issued under, so refreshing it must
+// replay the same client_id rather than falling back to AuthManager's
+// default, or UAA rejects the grant.
+type oauthClientTokenRefresher struct {
+	session  *Session
+	clientID string
+}
+
+// RefreshAuthToken exchanges the session's stored refresh token for a new
+// access/refresh token pair using the refresh_token grant, under the same
+// uaaClientID the original grant was issued to.
+func (r *oauthClientTokenRefresher) RefreshAuthToken() (string, error) {
+
+	uaaEndpoint := r.session.config.UaaEndpoint()
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {r.clientID},
+		"refresh_token": {r.session.config.RefreshToken()},
+	}
+
+	body, err := r.session.postDeviceForm(uaaEndpoint+"/oauth/token", form)
+	if err != nil {
+		uaaErr := uaaErrorResponse{}
+		if jsonErr := json.Unmarshal(body, &uaaErr); jsonErr == nil && uaaErr.Code != "" {
+			return "", fmt.Errorf("%s: %s", uaaErr.Code, uaaErr.Description)
+		}
+		return "", err
+	}
+
+	token := &deviceTokenResponse{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return "", err
+	}
+
+	accessToken := strings.TrimSpace(token.TokenType + " " + token.AccessToken)
+	r.session.config.SetAccessToken(accessToken)
+	r.session.config.SetRefreshToken(token.RefreshToken)
+	return accessToken, nil
+}
+
+// postDeviceForm submits a form-encoded POST to a UAA endpoint using the
+// session's direct-call httpClient and returns the raw response body. On a
+// non-2xx response it returns the body alongside the error so callers can
+// still parse a UAA error payload out of it.
+func (s *Session) postDeviceForm(endpoint string, form url.Values) ([]byte, error) {
+
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("request to %s failed with status %d", endpoint, resp.StatusCode)
+	}
+	return body, nil
+}
@@ -0,0 +1,202 @@
+package cfapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/cli/cf/configuration/coreconfig"
+)
+
+// newDeviceFlowTestSession builds a Session wired against server for the
+// device-flow tests below: a real coreconfig.Repository backed by
+// noopTestPersistor (see ccv3_test.go), pointed at the fake UAA's endpoint.
+func newDeviceFlowTestSession(server *httptest.Server) *Session {
+	s := &Session{httpClient: server.Client(), Log: NewLogger(false, "")}
+	s.config = coreconfig.NewRepositoryFromPersistor(&noopTestPersistor{}, func(error) {})
+	s.config.SetUaaEndpoint(server.URL)
+	return s
+}
+
+// withNoSleep stubs out deviceFlowSleep for the duration of a test so
+// authenticateDeviceFlow's poll loop doesn't wait out real poll intervals
+// or slow_down backoffs.
+func withNoSleep(t *testing.T) {
+	t.Helper()
+	original := deviceFlowSleep
+	deviceFlowSleep = func(time.Duration) {}
+	t.Cleanup(func() { deviceFlowSleep = original })
+}
+
+func deviceAuthorizeHandler(expiresIn int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"device_code":"dev-code","user_code":"USER-CODE",`+
+			`"verification_uri":"https://uaa.example.com/device","verification_uri_complete":"https://uaa.example.com/device?user_code=USER-CODE",`+
+			`"expires_in":%d,"interval":1}`, expiresIn)
+	}
+}
+
+func writeUAAError(w http.ResponseWriter, code string) {
+	w.WriteHeader(http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uaaErrorResponse{Code: code, Description: code})
+}
+
+// TestAuthenticateDeviceFlowPendingThenSlowDownThenSucceeds drives the full
+// polling state machine: authorization_pending (keep polling), slow_down
+// (back off), then a successful token response.
+func TestAuthenticateDeviceFlowPendingThenSlowDownThenSucceeds(t *testing.T) {
+	withNoSleep(t)
+
+	pollCount := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/device_authorize", deviceAuthorizeHandler(60))
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		pollCount++
+		switch pollCount {
+		case 1:
+			writeUAAError(w, deviceErrAuthorizationPending)
+		case 2:
+			writeUAAError(w, deviceErrSlowDown)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"abc123","refresh_token":"refresh-xyz","token_type":"bearer"}`)
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := newDeviceFlowTestSession(server)
+
+	if err := s.authenticateDeviceFlow("test-client"); err != nil {
+		t.Fatalf("authenticateDeviceFlow returned error: %s", err)
+	}
+	if pollCount != 3 {
+		t.Fatalf("expected 3 token polls (pending, slow_down, success), got %d", pollCount)
+	}
+	if got, want := s.config.AccessToken(), "bearer abc123"; got != want {
+		t.Errorf("AccessToken = %q, want %q", got, want)
+	}
+	if got, want := s.config.RefreshToken(), "refresh-xyz"; got != want {
+		t.Errorf("RefreshToken = %q, want %q", got, want)
+	}
+}
+
+// TestAuthenticateDeviceFlowExpiredToken asserts expired_token is terminal.
+func TestAuthenticateDeviceFlowExpiredToken(t *testing.T) {
+	withNoSleep(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/device_authorize", deviceAuthorizeHandler(60))
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		writeUAAError(w, deviceErrExpiredToken)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := newDeviceFlowTestSession(server)
+
+	err := s.authenticateDeviceFlow("test-client")
+	if err == nil || err.Error() != "device code expired before authorization was completed" {
+		t.Fatalf("authenticateDeviceFlow error = %v, want expired_token terminal error", err)
+	}
+}
+
+// TestAuthenticateDeviceFlowAccessDenied asserts access_denied is terminal.
+func TestAuthenticateDeviceFlowAccessDenied(t *testing.T) {
+	withNoSleep(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/device_authorize", deviceAuthorizeHandler(60))
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		writeUAAError(w, deviceErrAccessDenied)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := newDeviceFlowTestSession(server)
+
+	err := s.authenticateDeviceFlow("test-client")
+	if err == nil || err.Error() != "device authorization was denied" {
+		t.Fatalf("authenticateDeviceFlow error = %v, want access_denied terminal error", err)
+	}
+}
+
+// TestAuthenticateDeviceFlowDeadlineExpiry asserts a zero expires_in causes
+// the poll loop to bail out with a deadline error before ever polling
+// /oauth/token.
+func TestAuthenticateDeviceFlowDeadlineExpiry(t *testing.T) {
+	withNoSleep(t)
+
+	tokenPolled := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/device_authorize", deviceAuthorizeHandler(0))
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenPolled = true
+		writeUAAError(w, deviceErrAuthorizationPending)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := newDeviceFlowTestSession(server)
+
+	err := s.authenticateDeviceFlow("test-client")
+	if err == nil || err.Error() != "device authorization expired before it was approved" {
+		t.Fatalf("authenticateDeviceFlow error = %v, want deadline expiry error", err)
+	}
+	if tokenPolled {
+		t.Error("expected the poll loop to bail out on the expired deadline before polling /oauth/token")
+	}
+}
+
+// TestPollDeviceTokenDecodesSuccessResponse covers pollDeviceToken in
+// isolation, independent of the polling loop around it.
+func TestPollDeviceTokenDecodesSuccessResponse(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"abc123","refresh_token":"refresh-xyz","token_type":"bearer"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := newDeviceFlowTestSession(server)
+
+	token, err := s.pollDeviceToken(server.URL, "test-client", "dev-code")
+	if err != nil {
+		t.Fatalf("pollDeviceToken returned error: %s", err)
+	}
+	if token.AccessToken != "abc123" || token.RefreshToken != "refresh-xyz" || token.TokenType != "bearer" {
+		t.Errorf("unexpected token: %+v", token)
+	}
+}
+
+// TestPollDeviceTokenSurfacesUAAErrorCode covers pollDeviceToken's error
+// path: the RFC 8628 error code must come back as the error message
+// unmodified, since authenticateDeviceFlow switches on it directly.
+func TestPollDeviceTokenSurfacesUAAErrorCode(t *testing.T) {
+	for _, code := range []string{
+		deviceErrAuthorizationPending,
+		deviceErrSlowDown,
+		deviceErrExpiredToken,
+		deviceErrAccessDenied,
+	} {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+			writeUAAError(w, code)
+		})
+		server := httptest.NewServer(mux)
+
+		s := newDeviceFlowTestSession(server)
+		_, err := s.pollDeviceToken(server.URL, "test-client", "dev-code")
+		server.Close()
+
+		if err == nil || err.Error() != code {
+			t.Errorf("pollDeviceToken error = %v, want %q", err, code)
+		}
+	}
+}
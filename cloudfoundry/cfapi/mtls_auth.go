@@ -0,0 +1,197 @@
+package cfapi
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// NewSessionWithClientCertificate authenticates to UAA via the jwt-bearer
+// grant, signing the assertion with a PEM client certificate and private
+// key instead of authenticating with a username/password or client secret.
+// clientCert/clientKey are the PEM-encoded leaf certificate and private
+// key; clientCAChain is an optional PEM bundle of intermediate certificates
+// to present alongside the leaf. caCert, if set, is appended to the system
+// trust pool so the target's own server certificate can be verified
+// without disabling TLS verification entirely.
+//
+// This is UAA client-certificate authentication, not mTLS to Cloud
+// Controller: the client certificate only covers s.httpClient, i.e. this
+// jwt-bearer exchange itself and any direct endpoint call made through it
+// (CCv3Get, the SSH CA). Every call a resource or data source actually
+// makes goes through ccGateway/uaaGateway, which authenticate with the
+// bearer token this exchange produces, not the certificate - the vendored
+// net.Gateway behind them builds its own unexported *http.Client and
+// exposes no public way to hand it a *tls.Config (see initAPIInfo). There
+// is also no Terraform provider schema wiring yet: no client_certificate/
+// client_key/client_ca_chain fields exist on the provider, so this
+// constructor isn't reachable from a .tf config today. Both gaps are still
+// outstanding work, not implementation detail.
+func NewSessionWithClientCertificate(
+	endpoint, uaaClientID, clientCert, clientKey, clientCAChain, caCert string,
+	skipSslValidation bool) (s *Session, err error) {
+
+	cert, err := loadClientCertificate(clientCert, clientKey, clientCAChain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %s", err)
+	}
+
+	rootCAs, err := systemCertPoolPlus(caCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trust pool: %s", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		RootCAs:            rootCAs,
+		InsecureSkipVerify: skipSslValidation,
+	}
+
+	s = &Session{
+		httpClient: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+
+	if err = s.initAPIInfo(endpoint, uaaClientID, caCert, skipSslValidation); err != nil {
+		return nil, err
+	}
+
+	if !s.hasValidCachedToken(endpoint) {
+		if err = s.authenticateJWTBearer(uaaClientID, cert); err != nil {
+			return nil, err
+		}
+	}
+
+	refresher := &oauthClientTokenRefresher{session: s, clientID: uaaClientID}
+	s.ccGateway.SetTokenRefresher(refresher)
+	s.uaaGateway.SetTokenRefresher(refresher)
+	s.ccGateway.PollingEnabled = false
+
+	if err = s.initManagers(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// loadClientCertificate builds a tls.Certificate from a PEM leaf
+// certificate/key pair, appending an optional PEM chain of intermediates
+// after the leaf so the full chain is presented during the TLS handshake.
+func loadClientCertificate(certPEM, keyPEM, chainPEM string) (tls.Certificate, error) {
+
+	if chainPEM != "" {
+		certPEM = certPEM + "\n" + chainPEM
+	}
+	return tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+}
+
+// systemCertPoolPlus returns the system trust pool with caCert appended,
+// rather than replaced, so a custom CA can be trusted without losing the
+// ability to reach publicly-trusted endpoints.
+func systemCertPoolPlus(caCert string) (*x509.CertPool, error) {
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if caCert != "" {
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf("no certificates found in caCert")
+		}
+	}
+	return pool, nil
+}
+
+// jwtSigningMethodForKey picks the jwt.SigningMethod that matches the
+// client certificate's private key, so a certificate issued with an ECDSA
+// or Ed25519 key - as normal a choice for a service-account cert as RSA -
+// signs correctly instead of failing RS256's type assertion with an opaque
+// error.
+func jwtSigningMethodForKey(key interface{}) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		default:
+			return nil, fmt.Errorf("unsupported client certificate key: ECDSA curve %s is not one of P-256/P-384/P-521", k.Curve.Params().Name)
+		}
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported client certificate key type %T: only RSA, ECDSA and Ed25519 keys are supported", key)
+	}
+}
+
+// authenticateJWTBearer exchanges a JWT assertion signed with the client
+// certificate's private key for a UAA access/refresh token pair, using the
+// urn:ietf:params:oauth:grant-type:jwt-bearer grant. The assertion's iss and
+// sub claims are both set to uaaClientID, identifying the certificate as a
+// service account, and aud is UAA's own token endpoint.
+func (s *Session) authenticateJWTBearer(uaaClientID string, cert tls.Certificate) error {
+
+	uaaEndpoint := s.config.UaaEndpoint()
+
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Issuer:    uaaClientID,
+		Subject:   uaaClientID,
+		Audience:  jwt.ClaimStrings{uaaEndpoint + "/oauth/token"},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	}
+
+	method, err := jwtSigningMethodForKey(cert.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	assertion, err := jwt.NewWithClaims(method, claims).SignedString(cert.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to sign JWT assertion: %s", err)
+	}
+
+	form := url.Values{
+		"grant_type": {jwtBearerGrantType},
+		"client_id":  {uaaClientID},
+		"assertion":  {assertion},
+	}
+
+	body, err := s.postDeviceForm(uaaEndpoint+"/oauth/token", form)
+	if err != nil {
+		uaaErr := uaaErrorResponse{}
+		if jsonErr := json.Unmarshal(body, &uaaErr); jsonErr == nil && uaaErr.Code != "" {
+			return fmt.Errorf("%s: %s", uaaErr.Code, uaaErr.Description)
+		}
+		return err
+	}
+
+	token := &deviceTokenResponse{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return err
+	}
+
+	s.config.SetAccessToken(strings.TrimSpace(token.TokenType + " " + token.AccessToken))
+	s.config.SetRefreshToken(token.RefreshToken)
+	return nil
+}
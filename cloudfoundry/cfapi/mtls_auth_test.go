@@ -0,0 +1,210 @@
+package cfapi
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/cli/cf/configuration/coreconfig"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// selfSignCertificate builds a throwaway self-signed tls.Certificate around
+// key so authenticateJWTBearer has something to sign assertions with.
+func selfSignCertificate(t *testing.T, key crypto.Signer) tls.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test-client"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).Add(100 * 365 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate failed: %s", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newTestClientCertificate builds a throwaway self-signed tls.Certificate
+// so authenticateJWTBearer has an RSA private key to sign assertions with.
+func newTestClientCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey failed: %s", err)
+	}
+	return selfSignCertificate(t, key)
+}
+
+// newTestECDSAClientCertificate builds a throwaway self-signed
+// tls.Certificate around a P-256 key, so authenticateJWTBearer has an ECDSA
+// private key to sign assertions with.
+func newTestECDSAClientCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey failed: %s", err)
+	}
+	return selfSignCertificate(t, key)
+}
+
+// TestAuthenticateJWTBearerSignsAndSendsAssertion verifies the JWT assertion
+// authenticateJWTBearer builds: the iss/sub claims identify the client, aud
+// points at UAA's own token endpoint, and the signature validates against
+// the certificate's own public key. It then asserts a successful UAA
+// response is decoded into the session's access/refresh token.
+func TestAuthenticateJWTBearerSignsAndSendsAssertion(t *testing.T) {
+	cert := newTestClientCertificate(t)
+	privateKey := cert.PrivateKey.(*rsa.PrivateKey)
+
+	const clientID = "test-client"
+	var gotClaims jwt.RegisteredClaims
+	var gotGrantType, gotClientID string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %s", err)
+		}
+		gotGrantType = r.FormValue("grant_type")
+		gotClientID = r.FormValue("client_id")
+
+		token, err := jwt.ParseWithClaims(r.FormValue("assertion"), &gotClaims,
+			func(*jwt.Token) (interface{}, error) { return &privateKey.PublicKey, nil })
+		if err != nil || !token.Valid {
+			t.Fatalf("assertion did not validate: %s", err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"abc123","refresh_token":"refresh-xyz","token_type":"bearer"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := &Session{httpClient: server.Client()}
+	s.config = coreconfig.NewRepositoryFromPersistor(&noopTestPersistor{}, func(error) {})
+	s.config.SetUaaEndpoint(server.URL)
+
+	if err := s.authenticateJWTBearer(clientID, cert); err != nil {
+		t.Fatalf("authenticateJWTBearer returned error: %s", err)
+	}
+
+	if gotGrantType != jwtBearerGrantType {
+		t.Errorf("grant_type = %q, want %q", gotGrantType, jwtBearerGrantType)
+	}
+	if gotClientID != clientID {
+		t.Errorf("client_id = %q, want %q", gotClientID, clientID)
+	}
+	if gotClaims.Issuer != clientID || gotClaims.Subject != clientID {
+		t.Errorf("iss/sub = %q/%q, want both %q", gotClaims.Issuer, gotClaims.Subject, clientID)
+	}
+	wantAudience := server.URL + "/oauth/token"
+	if len(gotClaims.Audience) != 1 || gotClaims.Audience[0] != wantAudience {
+		t.Errorf("aud = %v, want [%q]", gotClaims.Audience, wantAudience)
+	}
+
+	if got, want := s.config.AccessToken(), "bearer abc123"; got != want {
+		t.Errorf("AccessToken = %q, want %q", got, want)
+	}
+	if got, want := s.config.RefreshToken(), "refresh-xyz"; got != want {
+		t.Errorf("RefreshToken = %q, want %q", got, want)
+	}
+}
+
+// TestAuthenticateJWTBearerSurfacesUAAError asserts a UAA error response
+// (e.g. the client certificate isn't recognized) comes back as a wrapped
+// error carrying UAA's error code and description, not the raw HTTP error.
+func TestAuthenticateJWTBearerSurfacesUAAError(t *testing.T) {
+	cert := newTestClientCertificate(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		writeUAAError(w, "invalid_client")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := &Session{httpClient: server.Client()}
+	s.config = coreconfig.NewRepositoryFromPersistor(&noopTestPersistor{}, func(error) {})
+	s.config.SetUaaEndpoint(server.URL)
+
+	err := s.authenticateJWTBearer("test-client", cert)
+	if err == nil || err.Error() != "invalid_client: invalid_client" {
+		t.Fatalf("authenticateJWTBearer error = %v, want wrapped invalid_client error", err)
+	}
+}
+
+// TestAuthenticateJWTBearerSignsWithECDSAKey asserts a certificate issued
+// with an ECDSA key - a perfectly normal choice for a service-account cert,
+// unlike the RSA key the other signing tests in this file use - signs the
+// assertion with ES256 instead of failing RS256's type assertion against
+// cert.PrivateKey.
+func TestAuthenticateJWTBearerSignsWithECDSAKey(t *testing.T) {
+	cert := newTestECDSAClientCertificate(t)
+	privateKey := cert.PrivateKey.(*ecdsa.PrivateKey)
+
+	var gotAlg string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %s", err)
+		}
+
+		var claims jwt.RegisteredClaims
+		token, err := jwt.ParseWithClaims(r.FormValue("assertion"), &claims,
+			func(tok *jwt.Token) (interface{}, error) { return &privateKey.PublicKey, nil })
+		if err != nil || !token.Valid {
+			t.Fatalf("assertion did not validate: %s", err)
+		}
+		gotAlg = token.Method.Alg()
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"abc123","refresh_token":"refresh-xyz","token_type":"bearer"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := &Session{httpClient: server.Client()}
+	s.config = coreconfig.NewRepositoryFromPersistor(&noopTestPersistor{}, func(error) {})
+	s.config.SetUaaEndpoint(server.URL)
+
+	if err := s.authenticateJWTBearer("test-client", cert); err != nil {
+		t.Fatalf("authenticateJWTBearer returned error: %s", err)
+	}
+	if gotAlg != "ES256" {
+		t.Errorf("signing algorithm = %q, want %q", gotAlg, "ES256")
+	}
+}
+
+// TestAuthenticateJWTBearerRejectsUnsupportedKeyType asserts an unrecognized
+// private key type fails with a clear, named error up front rather than an
+// opaque signing failure.
+func TestAuthenticateJWTBearerRejectsUnsupportedKeyType(t *testing.T) {
+	cert := tls.Certificate{PrivateKey: "not-a-key"}
+
+	s := &Session{httpClient: http.DefaultClient}
+	s.config = coreconfig.NewRepositoryFromPersistor(&noopTestPersistor{}, func(error) {})
+	s.config.SetUaaEndpoint("https://uaa.example.com")
+
+	err := s.authenticateJWTBearer("test-client", cert)
+	if err == nil || !strings.Contains(err.Error(), "unsupported client certificate key type") {
+		t.Fatalf("authenticateJWTBearer error = %v, want unsupported key type error", err)
+	}
+}
@@ -28,6 +28,7 @@ type Session struct {
 	refresher  coreconfig.APIConfigRefresher
 	ccGateway  net.Gateway
 	uaaGateway net.Gateway
+	persistor  configuration.Persistor
 
 	authManager      *AuthManager
 	stackManager     *StackManager
@@ -42,6 +43,7 @@ type Session struct {
 	buildpackManager *BuildpackManager
 	appManager       *AppManager
 	routeManager     *RouteManager
+	sshManager       *SSHManager
 
 	// Used for direct endpoint calls
 	httpClient *http.Client
@@ -99,17 +101,102 @@ func NewSession(
 	return
 }
 
+// NewSessionWithDeviceFlow authenticates against UAA using the OAuth 2.0
+// device authorization grant (RFC 8628) instead of a username/password or
+// client secret. It is meant for headless/CI environments and workstations
+// without an interactive browser session: the verification URI and user
+// code are printed via Session.Log for whoever completes the grant, and
+// the constructor blocks, polling UAA, until that happens (or the grant
+// is denied or expires).
+func NewSessionWithDeviceFlow(
+	endpoint, uaaClientID, caCert string,
+	skipSslValidation bool) (s *Session, err error) {
+
+	s = &Session{
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: skipSslValidation},
+			},
+		},
+	}
+
+	if err = s.initAPIInfo(endpoint, uaaClientID, caCert, skipSslValidation); err != nil {
+		return nil, err
+	}
+
+	if !s.hasValidCachedToken(endpoint) {
+		if err = s.authenticateDeviceFlow(uaaClientID); err != nil {
+			return nil, err
+		}
+	}
+
+	refresher := &oauthClientTokenRefresher{session: s, clientID: uaaClientID}
+	s.ccGateway.SetTokenRefresher(refresher)
+	s.uaaGateway.SetTokenRefresher(refresher)
+	s.ccGateway.PollingEnabled = false
+
+	if err = s.initManagers(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
 // initCliConnection
 func (s *Session) initCliConnection(
 	endpoint, user, password, caCert string,
 	skipSslValidation bool) (err error) {
 
+	if err = s.initAPIInfo(endpoint, user, caCert, skipSslValidation); err != nil {
+		return err
+	}
+	s.ccInfo.User = user
+	s.ccInfo.Password = password
+
+	if !s.hasValidCachedToken(endpoint) {
+		err = s.authManager.Authenticate(map[string]string{
+			"username": user,
+			"password": password,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	s.ccGateway.SetTokenRefresher(s.authManager)
+	s.uaaGateway.SetTokenRefresher(s.authManager)
+
+	s.ccGateway.PollingEnabled = false
+
+	return s.initManagers()
+}
+
+// initAPIInfo sets up the CC/UAA gateways and populates ccInfo from the
+// target's `/v2/info`, without performing any authentication. It is shared
+// by every Session constructor since the authentication step is the only
+// part that varies between them. identity distinguishes the on-disk token
+// cache between principals authenticating against the same endpoint (a
+// username, a UAA client ID, ...).
+//
+// The vendored net.Gateway behind ccGateway/uaaGateway builds its own
+// unexported *http.Client and exposes no public way to hand it a
+// *tls.Config, so a client certificate (NewSessionWithClientCertificate)
+// only ever covers s.httpClient; the gateways authenticate with the bearer
+// token alone, same as every other Session constructor.
+func (s *Session) initAPIInfo(endpoint, identity, caCert string, skipSslValidation bool) (err error) {
+
 	envDialTimeout := os.Getenv("CF_DIAL_TIMEOUT")
 
 	debug, _ := strconv.ParseBool(os.Getenv("CF_DEBUG"))
 	s.Log = NewLogger(debug, os.Getenv("CF_TRACE"))
 
-	s.config = coreconfig.NewRepositoryFromPersistor(&noopPersistor{}, func(err error) {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if !strings.HasPrefix(endpoint, "http") {
+		endpoint = "https://" + endpoint
+	}
+
+	s.persistor = newFileSecretsPersistor(endpoint, identity, s.Log)
+	s.config = coreconfig.NewRepositoryFromPersistor(s.persistor, func(err error) {
 		if err != nil {
 			s.Log.UI.Failed(err.Error())
 			os.Exit(1)
@@ -124,18 +211,11 @@ func (s *Session) initCliConnection(
 	s.uaaGateway = net.NewUAAGateway(s.config, s.Log.UI, s.Log.TracePrinter, envDialTimeout)
 	s.authManager = NewAuthManager(s.uaaGateway, s.config, net.NewRequestDumper(s.Log.TracePrinter))
 
-	endpoint = strings.TrimSuffix(endpoint, "/")
-	if !strings.HasPrefix(endpoint, "http") {
-		endpoint = "https://" + endpoint
-	}
-
 	err = s.ccGateway.GetResource(endpoint+"/v2/info", &s.ccInfo)
 	if err != nil {
 		return
 	}
 	s.ccInfo.APIEndpoint = endpoint
-	s.ccInfo.User = user
-	s.ccInfo.Password = password
 	s.ccInfo.SkipSslValidation = skipSslValidation
 
 	s.config.SetAPIEndpoint(endpoint)
@@ -160,18 +240,12 @@ func (s *Session) initCliConnection(
 		}
 	}
 
-	err = s.authManager.Authenticate(map[string]string{
-		"username": user,
-		"password": password,
-	})
-	if err != nil {
-		return err
-	}
-
-	s.ccGateway.SetTokenRefresher(s.authManager)
-	s.uaaGateway.SetTokenRefresher(s.authManager)
+	return nil
+}
 
-	s.ccGateway.PollingEnabled = false
+// initManagers constructs every resource manager hung off the session. It
+// assumes ccGateway/uaaGateway are already authenticated.
+func (s *Session) initManagers() (err error) {
 
 	s.userManager, err = newUserManager(s.config, s.uaaGateway, s.ccGateway, s.Log)
 	if err != nil {
@@ -222,8 +296,12 @@ func (s *Session) initCliConnection(
 	if err != nil {
 		return err
 	}
+	s.sshManager, err = newSSHManager(s)
+	if err != nil {
+		return err
+	}
 
-	return
+	return nil
 }
 
 // Info -
@@ -291,6 +369,11 @@ func (s *Session) AppManager() *AppManager {
 	return s.appManager
 }
 
+// SSHManager -
+func (s *Session) SSHManager() *SSHManager {
+	return s.sshManager
+}
+
 // GetFeatureFlags -
 func (s *Session) GetFeatureFlags() (featurFlags map[string]bool, err error) {
 
@@ -324,27 +407,43 @@ func (s *Session) SetFeatureFlags(featureFlags map[string]bool) (err error) {
 	return
 }
 
-// noopPersistor - No Op Persistor for CF CLI session
-type noopPersistor struct {
-}
+// hasValidCachedToken reports whether the config loaded from the on-disk
+// session cache already has a usable access token for endpoint. It checks
+// the token against UAA's /userinfo, which requires a valid bearer token -
+// unlike /v2/info, which CC serves unauthenticated and so would report
+// every cached token as valid, expired or not. Callers skip
+// re-authenticating when this returns true.
+func (s *Session) hasValidCachedToken(endpoint string) bool {
+	if s.config.AccessToken() == "" || s.config.APIEndpoint() != endpoint {
+		return false
+	}
 
-func newNoopPersistor() configuration.Persistor {
-	return &noopPersistor{}
-}
+	uaaEndpoint := s.config.UaaEndpoint()
+	if uaaEndpoint == "" {
+		return false
+	}
 
-func (p *noopPersistor) Delete() {
-}
+	req, err := http.NewRequest("GET", uaaEndpoint+"/userinfo", nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Authorization", s.config.AccessToken())
 
-func (p *noopPersistor) Exists() bool {
-	return false
-}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
 
-func (p *noopPersistor) Load(configuration.DataInterface) error {
-	return nil
+	return resp.StatusCode == http.StatusOK
 }
 
-func (p *noopPersistor) Save(configuration.DataInterface) error {
-	return nil
+// Logout discards the cached on-disk session so the next Session
+// constructor call re-authenticates from scratch.
+func (s *Session) Logout() {
+	if s.persistor != nil {
+		s.persistor.Delete()
+	}
 }
 
 // newUUID generates a random UUID according to RFC 4122
@@ -0,0 +1,193 @@
+package cfapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHManager exposes the `cf ssh`-style access surface for a foundation: the
+// Diego SSH proxy endpoint and its host key fingerprint (both advertised by
+// Cloud Controller), and the ability to mint short-lived SSH user
+// certificates signed by the foundation's SSH CA in place of long-lived
+// keys.
+//
+// STATUS: nothing in this provider calls SignUserKey yet. The backlog item
+// asks for a cloudfoundry_app_ssh_credential resource that takes a user's
+// public key, signs it through here, and surfaces the resulting certificate
+// plus a known_hosts entry (built from Endpoint/HostKeyFingerprint) as
+// resource attributes a Terraform config can read. Until that resource is
+// written, this type is reachable only from Go code holding a *Session
+// directly - this commit delivers the Session-level primitive, not the
+// resource the request asked for.
+type SSHManager struct {
+	session *Session
+
+	sshEndpoint        string
+	hostKeyFingerprint string
+	sshOAuthClient     string
+	caEndpoint         string
+}
+
+// newSSHManager builds the SSHManager the same way every other manager is
+// constructed from initManagers: eagerly, on the authenticated Session. It
+// makes one more GET of /v2/info for the SSH proxy endpoint and host key
+// fingerprint, which ccInfo does not carry.
+func newSSHManager(s *Session) (*SSHManager, error) {
+
+	info := struct {
+		AppSSHEndpoint           string `json:"app_ssh_endpoint"`
+		AppSSHHostKeyFingerprint string `json:"app_ssh_host_key_fingerprint"`
+	}{}
+	if err := s.ccGateway.GetResource(s.ccInfo.APIEndpoint+"/v2/info", &info); err != nil {
+		return nil, err
+	}
+
+	return &SSHManager{
+		session:            s,
+		sshEndpoint:        info.AppSSHEndpoint,
+		hostKeyFingerprint: info.AppSSHHostKeyFingerprint,
+		sshOAuthClient:     s.ccInfo.SSHOAuthClient,
+		caEndpoint:         deriveSSHCAEndpoint(s.ccInfo.APIEndpoint),
+	}, nil
+}
+
+// deriveSSHCAEndpoint defaults the SSH CA to ssh-ca.<system domain>, the
+// same convention initAPIInfo uses to derive the loggregator endpoint from
+// the API endpoint when CC doesn't advertise one directly. The system
+// domain excludes CC's own port: the SSH CA is a separate service, not part
+// of Cloud Controller, so there's no reason to assume it listens on CC's
+// port, and defaulting to it would be wrong on any foundation where it
+// doesn't.
+func deriveSSHCAEndpoint(apiEndpoint string) string {
+	domain := apiEndpoint
+	if i := strings.Index(domain, "://"); i >= 0 {
+		domain = domain[i+3:]
+	}
+	if i := strings.Index(domain, ":"); i >= 0 {
+		domain = domain[:i]
+	}
+	if i := strings.Index(domain, "."); i >= 0 {
+		domain = domain[i+1:]
+	}
+	return "https://ssh-ca." + domain
+}
+
+// Endpoint returns the CC-advertised SSH proxy address (host:port).
+func (m *SSHManager) Endpoint() string {
+	return m.sshEndpoint
+}
+
+// HostKeyFingerprint returns the SSH proxy's host key fingerprint, for
+// building a known_hosts entry alongside a signed user certificate.
+func (m *SSHManager) HostKeyFingerprint() string {
+	return m.hostKeyFingerprint
+}
+
+// AuthorizationCode exchanges the session's current UAA token for a
+// one-time SSH authorization code, which is presented as the password when
+// connecting to the app SSH proxy.
+func (m *SSHManager) AuthorizationCode() (string, error) {
+
+	s := m.session
+
+	authorizeURL := s.config.AuthenticationEndpoint() + "/oauth/authorize?" + url.Values{
+		"response_type": {"code"},
+		"client_id":     {m.sshOAuthClient},
+	}.Encode()
+
+	req, err := http.NewRequest("GET", authorizeURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", s.config.AccessToken())
+
+	client := &http.Client{
+		Transport: s.httpClient.Transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	redirectURL, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", fmt.Errorf("could not parse SSH authorization redirect: %s", err)
+	}
+
+	code := redirectURL.Query().Get("code")
+	if code == "" {
+		return "", fmt.Errorf("UAA did not return an SSH authorization code")
+	}
+	return code, nil
+}
+
+// signUserKeyRequest is the payload sent to the SSH CA's signing endpoint.
+type signUserKeyRequest struct {
+	PublicKey       string   `json:"public_key"`
+	Principals      []string `json:"principals"`
+	ValiditySeconds int      `json:"validity_seconds"`
+}
+
+// signUserKeyResponse is the SSH CA's response: an OpenSSH-format signed
+// user certificate.
+type signUserKeyResponse struct {
+	Certificate string `json:"certificate"`
+}
+
+// SignUserKey requests a short-lived user certificate from the foundation's
+// SSH CA for pub, restricted to principals and valid for validity.
+func (m *SSHManager) SignUserKey(pub ssh.PublicKey, principals []string, validity time.Duration) (*ssh.Certificate, error) {
+
+	s := m.session
+
+	reqBody, err := json.Marshal(signUserKeyRequest{
+		PublicKey:       string(ssh.MarshalAuthorizedKey(pub)),
+		Principals:      principals,
+		ValiditySeconds: int(validity.Seconds()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", m.caEndpoint+"/sign", strings.NewReader(string(reqBody)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", s.config.AccessToken())
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SSH CA at %s refused to sign the key: status %d", m.caEndpoint, resp.StatusCode)
+	}
+
+	signed := signUserKeyResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return nil, err
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(signed.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse signed certificate: %s", err)
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("SSH CA response was not a certificate")
+	}
+	return cert, nil
+}
@@ -0,0 +1,215 @@
+package cfapi
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/cli/cf/configuration/coreconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestDeriveSSHCAEndpoint(t *testing.T) {
+	cases := map[string]string{
+		"https://api.run.example.com":      "https://ssh-ca.run.example.com",
+		"https://api.system.my-pcf.io:443": "https://ssh-ca.system.my-pcf.io",
+		"http://api.internal.local":        "https://ssh-ca.internal.local",
+	}
+
+	for apiEndpoint, want := range cases {
+		if got := deriveSSHCAEndpoint(apiEndpoint); got != want {
+			t.Errorf("deriveSSHCAEndpoint(%q) = %q, want %q", apiEndpoint, got, want)
+		}
+	}
+}
+
+// newSSHManagerTestSession builds a Session with a real coreconfig.Repository
+// backed by noopTestPersistor (see ccv3_test.go), wired against server.
+func newSSHManagerTestSession(server *httptest.Server) *Session {
+	s := &Session{httpClient: server.Client()}
+	s.config = coreconfig.NewRepositoryFromPersistor(&noopTestPersistor{}, func(error) {})
+	return s
+}
+
+// TestSSHManagerAuthorizationCodeParsesRedirect exercises AuthorizationCode
+// against a fake UAA /oauth/authorize that replies with the redirect UAA
+// normally sends back to the app SSH proxy, carrying the one-time code as a
+// query parameter.
+func TestSSHManagerAuthorizationCodeParsesRedirect(t *testing.T) {
+	var gotResponseType, gotClientID, gotAuth string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		gotResponseType = r.URL.Query().Get("response_type")
+		gotClientID = r.URL.Query().Get("client_id")
+		gotAuth = r.Header.Get("Authorization")
+		http.Redirect(w, r, "https://app-ssh.example.com/?code=ssh-auth-code", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := newSSHManagerTestSession(server)
+	s.config.SetAuthenticationEndpoint(server.URL)
+	s.config.SetAccessToken("bearer abc123")
+
+	m := &SSHManager{session: s, sshOAuthClient: "ssh-proxy"}
+
+	code, err := m.AuthorizationCode()
+	if err != nil {
+		t.Fatalf("AuthorizationCode returned error: %s", err)
+	}
+	if code != "ssh-auth-code" {
+		t.Errorf("code = %q, want %q", code, "ssh-auth-code")
+	}
+	if gotResponseType != "code" {
+		t.Errorf("response_type = %q, want %q", gotResponseType, "code")
+	}
+	if gotClientID != "ssh-proxy" {
+		t.Errorf("client_id = %q, want %q", gotClientID, "ssh-proxy")
+	}
+	if gotAuth != "bearer abc123" {
+		t.Errorf("Authorization header = %q, want %q", gotAuth, "bearer abc123")
+	}
+}
+
+// TestSSHManagerAuthorizationCodeMissingCode asserts a redirect with no code
+// query parameter is a clear error rather than an empty string mistaken for
+// a valid authorization code.
+func TestSSHManagerAuthorizationCodeMissingCode(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://app-ssh.example.com/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := newSSHManagerTestSession(server)
+	s.config.SetAuthenticationEndpoint(server.URL)
+
+	m := &SSHManager{session: s, sshOAuthClient: "ssh-proxy"}
+
+	if _, err := m.AuthorizationCode(); err == nil {
+		t.Fatal("expected an error when UAA's redirect carries no code")
+	}
+}
+
+// newSignedUserCertificate signs userPub as an SSH user certificate under a
+// throwaway Ed25519 CA key and returns it in the OpenSSH authorized-key
+// text format the SSH CA's /sign endpoint responds with.
+func newSignedUserCertificate(t *testing.T, userPub ssh.PublicKey, principals []string) string {
+	t.Helper()
+
+	_, caPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey failed: %s", err)
+	}
+	caSigner, err := ssh.NewSignerFromSigner(caPriv)
+	if err != nil {
+		t.Fatalf("ssh.NewSignerFromSigner failed: %s", err)
+	}
+
+	cert := &ssh.Certificate{
+		Key:             userPub,
+		CertType:        ssh.UserCert,
+		ValidPrincipals: principals,
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, caSigner); err != nil {
+		t.Fatalf("SignCert failed: %s", err)
+	}
+	return string(ssh.MarshalAuthorizedKey(cert))
+}
+
+// TestSSHManagerSignUserKeySendsRequestAndParsesCertificate exercises
+// SignUserKey against a fake SSH CA: it checks the request carries the
+// public key, principals and validity SignUserKey was called with, then
+// asserts the CA's signed certificate response is parsed back correctly.
+func TestSSHManagerSignUserKeySendsRequestAndParsesCertificate(t *testing.T) {
+	userPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey failed: %s", err)
+	}
+	sshUserPub, err := ssh.NewPublicKey(userPub)
+	if err != nil {
+		t.Fatalf("ssh.NewPublicKey failed: %s", err)
+	}
+
+	principals := []string{"app-guid"}
+	certLine := newSignedUserCertificate(t, sshUserPub, principals)
+
+	var gotAuth string
+	var gotBody signUserKeyRequest
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sign", func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Fatalf("failed to decode sign request body: %s", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(signUserKeyResponse{Certificate: certLine})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	s := newSSHManagerTestSession(server)
+	s.config.SetAccessToken("bearer abc123")
+
+	m := &SSHManager{session: s, caEndpoint: server.URL}
+
+	got, err := m.SignUserKey(sshUserPub, principals, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("SignUserKey returned error: %s", err)
+	}
+
+	if gotAuth != "bearer abc123" {
+		t.Errorf("Authorization header = %q, want %q", gotAuth, "bearer abc123")
+	}
+	if want := string(ssh.MarshalAuthorizedKey(sshUserPub)); gotBody.PublicKey != want {
+		t.Errorf("request public_key = %q, want %q", gotBody.PublicKey, want)
+	}
+	if len(gotBody.Principals) != 1 || gotBody.Principals[0] != "app-guid" {
+		t.Errorf("request principals = %v, want [app-guid]", gotBody.Principals)
+	}
+	if gotBody.ValiditySeconds != 300 {
+		t.Errorf("request validity_seconds = %d, want 300", gotBody.ValiditySeconds)
+	}
+	if got.CertType != ssh.UserCert {
+		t.Errorf("cert type = %d, want ssh.UserCert", got.CertType)
+	}
+	if len(got.ValidPrincipals) != 1 || got.ValidPrincipals[0] != "app-guid" {
+		t.Errorf("cert principals = %v, want [app-guid]", got.ValidPrincipals)
+	}
+}
+
+// TestSSHManagerSignUserKeyRejectsNon200 asserts a non-200 SSH CA response
+// surfaces as an error rather than SignUserKey trying to parse an empty or
+// unrelated body as a certificate.
+func TestSSHManagerSignUserKeyRejectsNon200(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sign", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	userPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey failed: %s", err)
+	}
+	sshUserPub, err := ssh.NewPublicKey(userPub)
+	if err != nil {
+		t.Fatalf("ssh.NewPublicKey failed: %s", err)
+	}
+
+	s := newSSHManagerTestSession(server)
+	m := &SSHManager{session: s, caEndpoint: server.URL}
+
+	if _, err := m.SignUserKey(sshUserPub, []string{"app-guid"}, time.Minute); err == nil {
+		t.Fatal("expected an error for a non-200 SSH CA response")
+	}
+}
@@ -0,0 +1,225 @@
+package cfapi
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/cli/cf/configuration"
+	"golang.org/x/crypto/scrypt"
+)
+
+// tokenCacheKeyEnvVar, when set, is used to derive the encryption key that
+// protects the on-disk session cache. Without it the cache is still written
+// (so repeated plans/applies don't re-authenticate), but in the clear, with
+// a warning logged.
+const tokenCacheKeyEnvVar = "CF_TOKEN_CACHE_KEY"
+
+// fileSecretsPersistor is a configuration.Persistor that caches a CF CLI
+// session (endpoints, access/refresh tokens, UAA info) on disk between
+// invocations, so Terraform doesn't have to re-authenticate and re-fetch
+// /v2/info on every plan/apply against a busy foundation.
+type fileSecretsPersistor struct {
+	path string
+	log  *Logger
+}
+
+// newFileSecretsPersistor returns a persistor scoped to a single
+// endpoint+identity pair (identity is the username, UAA client ID, or other
+// principal being authenticated), so distinct sessions against the same
+// foundation don't collide on one cache file.
+func newFileSecretsPersistor(endpoint, identity string, log *Logger) *fileSecretsPersistor {
+
+	cacheDir := os.Getenv("XDG_CACHE_HOME")
+	if cacheDir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			cacheDir = filepath.Join(home, ".cache")
+		}
+	}
+	cacheDir = filepath.Join(cacheDir, "terraform-provider-cf")
+
+	sum := sha256.Sum256([]byte(endpoint + identity))
+	path := filepath.Join(cacheDir, fmt.Sprintf("session-%s.json", hex.EncodeToString(sum[:])))
+
+	return &fileSecretsPersistor{path: path, log: log}
+}
+
+// Delete removes the cached session, if any.
+func (p *fileSecretsPersistor) Delete() {
+	os.Remove(p.path)
+}
+
+// Exists reports whether a cached session file is present.
+func (p *fileSecretsPersistor) Exists() bool {
+	_, err := os.Stat(p.path)
+	return err == nil
+}
+
+// Load reads and decrypts the cached session into data. A missing cache
+// file is not an error: data is simply left at its zero value. The cache is
+// only ever an optimization to skip re-authenticating - coreconfig's
+// NewRepositoryFromPersistor callback treats any error Load returns as fatal
+// to the whole process, so a cache the persistor can't read back (wrong or
+// rotated CF_TOKEN_CACHE_KEY, a file truncated by a crash mid-Save) is
+// treated the same as no cache at all: log a warning, remove the stale
+// file, and let the caller fall through to a fresh Authenticate.
+func (p *fileSecretsPersistor) Load(data configuration.DataInterface) error {
+
+	raw, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	plaintext, err := decryptSessionCache(raw)
+	if err != nil {
+		if p.log != nil {
+			p.log.UI.Warn("could not read cached CF session (%s); re-authenticating", err.Error())
+		}
+		p.Delete()
+		return nil
+	}
+
+	if err := json.Unmarshal(plaintext, data); err != nil {
+		if p.log != nil {
+			p.log.UI.Warn("could not read cached CF session (%s); re-authenticating", err.Error())
+		}
+		p.Delete()
+		return nil
+	}
+	return nil
+}
+
+// Save encrypts and writes data to the cache file, creating its parent
+// directory if needed, with mode 0600 so only the owning user can read the
+// cached tokens.
+func (p *fileSecretsPersistor) Save(data configuration.DataInterface) error {
+
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	ciphertext, err := encryptSessionCache(plaintext, p.log)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.path, ciphertext, 0600)
+}
+
+// Cache file layout: a 1-byte format tag followed by the payload, so a
+// cache written in the clear (no CF_TOKEN_CACHE_KEY set) can still be read
+// back if a passphrase is introduced later. An encrypted cache cannot be
+// read back once CF_TOKEN_CACHE_KEY is unset: decryptSessionCache rejects
+// it, and Load then discards it.
+const (
+	sessionCacheFormatPlain     byte = 0x00
+	sessionCacheFormatEncrypted byte = 0x01
+
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptKeyLen  = 32
+	scryptSaltLen = 16
+)
+
+// encryptSessionCache encrypts plaintext with AES-GCM using a key derived
+// via scrypt from CF_TOKEN_CACHE_KEY. If that env var is unset, plaintext is
+// written as-is behind a warning log.
+func encryptSessionCache(plaintext []byte, log *Logger) ([]byte, error) {
+
+	passphrase := os.Getenv(tokenCacheKeyEnvVar)
+	if passphrase == "" {
+		if log != nil {
+			log.UI.Warn("%s is not set; caching the CF session token on disk in plaintext", tokenCacheKeyEnvVar)
+		}
+		return append([]byte{sessionCacheFormatPlain}, plaintext...), nil
+	}
+
+	salt := make([]byte, scryptSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, 1+len(salt)+len(nonce)+len(plaintext)+gcm.Overhead())
+	out = append(out, sessionCacheFormatEncrypted)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	out = gcm.Seal(out, nonce, plaintext, nil)
+	return out, nil
+}
+
+// decryptSessionCache reverses encryptSessionCache.
+func decryptSessionCache(raw []byte) ([]byte, error) {
+
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("empty session cache")
+	}
+	format, raw := raw[0], raw[1:]
+
+	if format == sessionCacheFormatPlain {
+		return raw, nil
+	}
+
+	passphrase := os.Getenv(tokenCacheKeyEnvVar)
+	if passphrase == "" {
+		return nil, fmt.Errorf("session cache is encrypted but %s is not set", tokenCacheKeyEnvVar)
+	}
+
+	if len(raw) < scryptSaltLen {
+		return nil, fmt.Errorf("corrupt session cache")
+	}
+	salt, raw := raw[:scryptSaltLen], raw[scryptSaltLen:]
+
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) < gcm.NonceSize() {
+		return nil, fmt.Errorf("corrupt session cache")
+	}
+	nonce, ciphertext := raw[:gcm.NonceSize()], raw[gcm.NonceSize():]
+
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
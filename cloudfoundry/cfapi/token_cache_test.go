@@ -0,0 +1,101 @@
+package cfapi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/cli/cf/configuration/coreconfig"
+)
+
+func TestEncryptDecryptSessionCacheRoundTrip(t *testing.T) {
+	os.Setenv(tokenCacheKeyEnvVar, "correct-horse-battery-staple")
+	defer os.Unsetenv(tokenCacheKeyEnvVar)
+
+	plaintext := []byte(`{"AccessToken":"bearer abc123","RefreshToken":"refresh-xyz"}`)
+
+	ciphertext, err := encryptSessionCache(plaintext, nil)
+	if err != nil {
+		t.Fatalf("encryptSessionCache returned error: %s", err)
+	}
+	if ciphertext[0] != sessionCacheFormatEncrypted {
+		t.Fatalf("expected encrypted format tag, got %x", ciphertext[0])
+	}
+
+	decrypted, err := decryptSessionCache(ciphertext)
+	if err != nil {
+		t.Fatalf("decryptSessionCache returned error: %s", err)
+	}
+	if string(decrypted) != string(plaintext) {
+		t.Fatalf("round trip mismatch: got %q, want %q", decrypted, plaintext)
+	}
+}
+
+// TestFileSecretsPersistorLoadCorruptCacheFallsBackToFreshAuth exercises the
+// path coreconfig.NewRepositoryFromPersistor drives at startup: a Load that
+// can't make sense of what's on disk (wrong/rotated CF_TOKEN_CACHE_KEY, or a
+// file truncated by a crash mid-Save) must not propagate an error, since the
+// caller treats any Load error as fatal to the whole process. It should
+// behave exactly like a missing cache instead.
+func TestFileSecretsPersistorLoadCorruptCacheFallsBackToFreshAuth(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.json")
+	if err := os.WriteFile(path, []byte{sessionCacheFormatEncrypted, 0x01, 0x02}, 0600); err != nil {
+		t.Fatalf("failed to seed corrupt cache file: %s", err)
+	}
+
+	p := &fileSecretsPersistor{path: path, log: NewLogger(false, "")}
+
+	failed := false
+	config := coreconfig.NewRepositoryFromPersistor(p, func(err error) { failed = true })
+
+	// coreconfig calls Load lazily, on the first read of the config.
+	accessToken := config.AccessToken()
+	if failed {
+		t.Fatal("a corrupt cache must not be treated as a fatal error")
+	}
+	if accessToken != "" {
+		t.Fatalf("expected a zero-value config after a corrupt cache load, got access token %q", accessToken)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("expected the corrupt cache file to be removed")
+	}
+}
+
+func TestDecryptSessionCacheWrongPassphrase(t *testing.T) {
+	os.Setenv(tokenCacheKeyEnvVar, "correct-horse-battery-staple")
+	ciphertext, err := encryptSessionCache([]byte(`{"AccessToken":"bearer abc123"}`), nil)
+	if err != nil {
+		t.Fatalf("encryptSessionCache returned error: %s", err)
+	}
+	os.Unsetenv(tokenCacheKeyEnvVar)
+
+	os.Setenv(tokenCacheKeyEnvVar, "wrong-passphrase")
+	defer os.Unsetenv(tokenCacheKeyEnvVar)
+
+	if _, err := decryptSessionCache(ciphertext); err == nil {
+		t.Fatal("expected decryptSessionCache to fail with the wrong passphrase")
+	}
+}
+
+func TestEncryptDecryptSessionCachePlaintextFallback(t *testing.T) {
+	os.Unsetenv(tokenCacheKeyEnvVar)
+
+	plaintext := []byte(`{"AccessToken":"bearer abc123"}`)
+
+	ciphertext, err := encryptSessionCache(plaintext, nil)
+	if err != nil {
+		t.Fatalf("encryptSessionCache returned error: %s", err)
+	}
+	if ciphertext[0] != sessionCacheFormatPlain {
+		t.Fatalf("expected plaintext format tag, got %x", ciphertext[0])
+	}
+
+	decrypted, err := decryptSessionCache(ciphertext)
+	if err != nil {
+		t.Fatalf("decryptSessionCache returned error: %s", err)
+	}
+	if string(decrypted) != string(plaintext) {
+		t.Fatalf("round trip mismatch: got %q, want %q", decrypted, plaintext)
+	}
+}